@@ -14,47 +14,51 @@ import (
 
 var myLog *logrus.Logger
 
-// 只导出以下常用方法
-var (
-	Trace func(args ...interface{})
-	Debug func(args ...interface{})
-	Info  func(args ...interface{})
-	Warn  func(args ...interface{})
-	Error func(args ...interface{})
-	Fatal func(args ...interface{})
-	Panic func(args ...interface{})
-)
-
 func init() {
 
 	myLog = logrus.New()
 
-	myLog.SetFormatter(&NestFormatter{
-		TrimMessages:    true,                              //去掉消息中的空格
-		HideKeys:        true,                              //隐藏key
-		TimestampFormat: "2006-01-02 15:04:05",             //时间格式
-		FieldsOrder:     []string{"component", "category"}, //字段排序
-		CallerFirst:     true,                              //先打印调用者信息
-		NoFieldsColors:  true,                              //不给自己的字段加颜色
+	myLog.SetFormatter(defaultNestFormatter())
+	myLog.SetReportCaller(true)
+
+	Info("=== lance log init success ===")
+}
+
+// defaultNestFormatter 构造 lancelog 默认使用的 NestFormatter 配置，供 init() 和
+// SetFormat(FormatNested) 共用，避免同一份配置在两处各抄一遍、改的时候漏掉一处
+func defaultNestFormatter() *NestFormatter {
+	return &NestFormatter{
+		TrimMessages:    true,                                                     //去掉消息中的空格
+		HideKeys:        true,                                                     //隐藏key
+		TimestampFormat: "2006-01-02 15:04:05",                                    //时间格式
+		FieldsOrder:     []string{"trace_id", "span_id", "component", "category"}, //字段排序
+		CallerFirst:     true,                                                     //先打印调用者信息
+		NoFieldsColors:  true,                                                     //不给自己的字段加颜色
 		CustomCallerFormatter: func(f *runtime.Frame) string { //自定义文件函数等信息
 
 			s := strings.Split(f.Function, ".")
 			funcName := s[len(s)-1]
 			return fmt.Sprintf(" [%s:%d][%s()]", path.Base(f.File), f.Line, funcName)
 		},
-	})
-	myLog.SetReportCaller(true)
+	}
+}
 
-	Trace = myLog.Trace
-	Debug = myLog.Debug
-	Info = myLog.Info
-	Warn = myLog.Warn
-	Error = myLog.Error
-	Fatal = myLog.Fatal
-	Panic = myLog.Panic
-	Info("=== lance log init success ===")
+// 只导出以下常用方法，均为真正的函数而非方法值，自行计算 caller 以支持 SetCallerSkip
+func Trace(args ...interface{}) { logAt(TraceLevel, args...) }
+func Debug(args ...interface{}) { logAt(DebugLevel, args...) }
+func Info(args ...interface{})  { logAt(InfoLevel, args...) }
+func Warn(args ...interface{})  { logAt(WarnLevel, args...) }
+func Error(args ...interface{}) { logAt(ErrorLevel, args...) }
+
+// Fatal 记录一条 Fatal 级别日志后终止进程，与 logrus.Entry.Fatal 语义一致：
+// 即使该级别被过滤掉，也始终调用 myLog.Exit(1)
+func Fatal(args ...interface{}) {
+	logAt(FatalLevel, args...)
+	myLog.Exit(1)
 }
 
+func Panic(args ...interface{}) { logAt(PanicLevel, args...) }
+
 // 额外的配置需求
 type Logger = logrus.Logger
 type Formatter = logrus.Formatter
@@ -78,8 +82,11 @@ func SetOutput(out io.Writer) {
 	myLog.SetOutput(out)
 }
 
+// SetFormatter 设置自定义 Formatter。传入的 formatter 会被包一层，使采样丢弃
+// （SetSampler）和 caller 隐藏字段在它身上也能正确生效，不需要 formatter 自己关心
+// lancelog 的内部实现细节
 func SetFormatter(formatter Formatter) {
-	myLog.SetFormatter(formatter)
+	myLog.SetFormatter(wrapFormatter(formatter))
 }
 
 func SetReportCaller(include bool) {
@@ -140,10 +147,17 @@ type NestFormatter struct {
 
 	// CustomCallerFormatter - set custom formatter for caller info
 	CustomCallerFormatter func(*runtime.Frame) string
+
+	// PackageFilter - GOPATH/module prefix to strip from Caller.File, keeps logs short in long-module-path projects
+	PackageFilter string
 }
 
 // Format an mlog entry
 func (f *NestFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Data[sampledDropKey] == true {
+		return nil, nil
+	}
+
 	levelColor := getColorByLevel(entry.Level)
 
 	timestampFormat := f.TimestampFormat
@@ -221,18 +235,27 @@ func (f *NestFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 }
 
 func (f *NestFormatter) writeCaller(b *bytes.Buffer, entry *logrus.Entry) {
-	if entry.HasCaller() {
-		if f.CustomCallerFormatter != nil {
-			fmt.Fprintf(b, f.CustomCallerFormatter(entry.Caller))
-		} else {
-			fmt.Fprintf(
-				b,
-				" (%s:%d %s)",
-				entry.Caller.File,
-				entry.Caller.Line,
-				entry.Caller.Function,
-			)
-		}
+	frame, ok := callerFrameForEntry(entry)
+	if !ok {
+		return
+	}
+
+	if f.PackageFilter != "" {
+		trimmed := *frame
+		trimmed.File = strings.TrimPrefix(trimmed.File, f.PackageFilter)
+		frame = &trimmed
+	}
+
+	if f.CustomCallerFormatter != nil {
+		fmt.Fprintf(b, f.CustomCallerFormatter(frame))
+	} else {
+		fmt.Fprintf(
+			b,
+			" (%s:%d %s)",
+			frame.File,
+			frame.Line,
+			frame.Function,
+		)
 	}
 }
 
@@ -240,6 +263,9 @@ func (f *NestFormatter) writeFields(b *bytes.Buffer, entry *logrus.Entry) {
 	if len(entry.Data) != 0 {
 		fields := make([]string, 0, len(entry.Data))
 		for field := range entry.Data {
+			if field == callerDataKey {
+				continue
+			}
 			fields = append(fields, field)
 		}
 
@@ -265,6 +291,9 @@ func (f *NestFormatter) writeOrderedFields(b *bytes.Buffer, entry *logrus.Entry)
 	if length > 0 {
 		notFoundFields := make([]string, 0, length)
 		for field := range entry.Data {
+			if field == callerDataKey {
+				continue
+			}
 			if foundFieldsMap[field] == false {
 				notFoundFields = append(notFoundFields, field)
 			}
@@ -0,0 +1,228 @@
+package lancelog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DropPolicy 决定异步写入队列打满后如何处理新到达的日志
+type DropPolicy int
+
+const (
+	// DropOldest 丢弃队列中最早的一条，为新日志腾出位置
+	DropOldest DropPolicy = iota
+	// DropNewest 直接丢弃当前这条新日志，保留队列中已有的
+	DropNewest
+	// Block 阻塞写入方，直到队列有空位
+	Block
+)
+
+// AsyncStats 是 Stats 返回的异步写入队列统计信息
+type AsyncStats struct {
+	// Dropped 因队列打满而被丢弃的日志条数
+	Dropped uint64
+	// QueueDepth 当前队列中待写入的日志条数
+	QueueDepth int
+}
+
+// asyncWriter 把日志条目放入有界 channel，由后台 goroutine 异步写入真正的输出
+type asyncWriter struct {
+	underlying io.Writer
+	policy     DropPolicy
+	ch         chan []byte
+	done       chan struct{}
+	wg         sync.WaitGroup
+	dropped    uint64
+	bypass     int32 // 置 1 时下一次 Write 绕过队列直接同步写入
+
+	// enqueued/completed 共同定义 flush 真正要等待的条件：enqueued 在条目被放入 ch 时
+	// 递增，completed 在条目离开 ch 时递增（无论是被 run 写出还是被 DropOldest 淘汰）。
+	// 只看 len(ch)==0 是不够的——run 可能刚把最后一条从 ch 里取出，真正的底层 Write
+	// 还没返回，这段时间里 flush 必须继续等待
+	enqueued  uint64
+	completed uint64
+}
+
+var (
+	asyncMu       sync.Mutex
+	currentAsync  *asyncWriter
+	asyncHookOnce sync.Once
+)
+
+// EnableAsync 把当前输出包装为异步/缓冲模式：日志先写入一个容量为 bufSize 的 channel，
+// 由后台 goroutine 负责真正的写出，policy 控制队列打满时的丢弃策略。
+// 会安装一个 Fatal/Panic 钩子（只安装一次），确保进程退出前未写出的日志被同步刷盘。
+// 重复调用会先停掉上一个实例的后台 goroutine，避免 goroutine 和 hook 的累积泄漏。
+func EnableAsync(bufSize int, policy DropPolicy) {
+	asyncMu.Lock()
+	prev := currentAsync
+	underlying := myLog.Out
+	if prev != nil {
+		// 上一个 asyncWriter 已经把自己安装成了 myLog.Out，真正的落地目标要从它身上继承，
+		// 否则这里会把新的 asyncWriter 包在旧的之上
+		underlying = prev.underlying
+	}
+
+	aw := &asyncWriter{
+		underlying: underlying,
+		policy:     policy,
+		ch:         make(chan []byte, bufSize),
+		done:       make(chan struct{}),
+	}
+	currentAsync = aw
+	asyncMu.Unlock()
+
+	if prev != nil {
+		prev.stop()
+	}
+
+	aw.wg.Add(1)
+	go aw.run()
+
+	myLog.SetOutput(aw)
+
+	asyncHookOnce.Do(func() {
+		myLog.AddHook(&asyncExitHook{})
+	})
+}
+
+func (aw *asyncWriter) run() {
+	defer aw.wg.Done()
+	for {
+		select {
+		case b, ok := <-aw.ch:
+			if !ok {
+				return
+			}
+			aw.underlying.Write(b)
+			atomic.AddUint64(&aw.completed, 1)
+		case <-aw.done:
+			return
+		}
+	}
+}
+
+// stop 排空队列后让 run 的后台 goroutine 退出，并等待其真正结束
+func (aw *asyncWriter) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	aw.flush(ctx)
+
+	close(aw.done)
+	aw.wg.Wait()
+}
+
+// Write 实现 io.Writer，按 policy 把日志条目投递到后台 goroutine
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	if atomic.CompareAndSwapInt32(&aw.bypass, 1, 0) {
+		return aw.underlying.Write(p)
+	}
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	switch aw.policy {
+	case Block:
+		aw.ch <- buf
+		atomic.AddUint64(&aw.enqueued, 1)
+	case DropNewest:
+		select {
+		case aw.ch <- buf:
+			atomic.AddUint64(&aw.enqueued, 1)
+		default:
+			atomic.AddUint64(&aw.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case aw.ch <- buf:
+				atomic.AddUint64(&aw.enqueued, 1)
+				return len(p), nil
+			default:
+				select {
+				case <-aw.ch:
+					atomic.AddUint64(&aw.dropped, 1)
+					atomic.AddUint64(&aw.completed, 1)
+				default:
+				}
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush 等待所有已入队的条目都被处理完（写出或被 DropOldest 淘汰），超出 ctx 的期限则
+// 返回 ctx.Err()。不能只看 len(ch)==0——那只说明 run 把最后一条从 ch 里取出来了，
+// 底层的 Write 可能还没返回，此时数据其实还没真正落地
+func (aw *asyncWriter) flush(ctx context.Context) error {
+	ticker := time.NewTicker(2 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadUint64(&aw.completed) != atomic.LoadUint64(&aw.enqueued) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Flush 阻塞直到异步队列中的日志全部写出，或 ctx 到期。未启用异步模式时直接返回 nil
+func Flush(ctx context.Context) error {
+	asyncMu.Lock()
+	aw := currentAsync
+	asyncMu.Unlock()
+
+	if aw == nil {
+		return nil
+	}
+	return aw.flush(ctx)
+}
+
+// Stats 返回异步写入队列当前的丢弃计数与积压深度，未启用异步模式时返回零值
+func Stats() AsyncStats {
+	asyncMu.Lock()
+	aw := currentAsync
+	asyncMu.Unlock()
+
+	if aw == nil {
+		return AsyncStats{}
+	}
+	return AsyncStats{
+		Dropped:    atomic.LoadUint64(&aw.dropped),
+		QueueDepth: len(aw.ch),
+	}
+}
+
+// asyncExitHook 在 Fatal/Panic 级别的日志即将退出进程前，强制把已排队的日志同步刷盘，
+// 并让触发退出的这一条日志绕过队列直接写出，避免最后一条日志丢失。
+// 只会被安装一次，始终通过 currentAsync 找到当前生效的 asyncWriter
+type asyncExitHook struct{}
+
+func (h *asyncExitHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel, logrus.PanicLevel}
+}
+
+func (h *asyncExitHook) Fire(entry *logrus.Entry) error {
+	asyncMu.Lock()
+	aw := currentAsync
+	asyncMu.Unlock()
+
+	if aw == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	aw.flush(ctx)
+
+	atomic.StoreInt32(&aw.bypass, 1)
+	return nil
+}
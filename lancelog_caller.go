@@ -0,0 +1,121 @@
+package lancelog
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// callerDataKey 是附加在 entry.Data 上、用于携带手动计算出的 caller 信息的隐藏字段，
+// 不会作为普通字段被格式化器渲染
+const callerDataKey = "__lancelog_caller__"
+
+// callerBaseSkip 是 logAt 内部到真正调用方之间固定经过的帧数：
+// callerAt -> frameWithSkip -> logAt -> Trace/Debug/Info/Warn/Error/Fatal/Panic -> 调用方
+const callerBaseSkip = 4
+
+var (
+	callerSkipMu        sync.RWMutex
+	callerSkipDefault   int
+	callerSkipByPackage map[string]int
+)
+
+// SetCallerSkip 设置全局额外跳过的调用栈帧数。当业务代码自己封装了一层 helper 再调用
+// Trace/Debug/Info/Warn/Error/Fatal/Panic 时，caller 信息默认会指向这层 helper 而不是
+// 真正的调用处，调大 n 可以向上多跳过相应的帧数
+func SetCallerSkip(n int) {
+	callerSkipMu.Lock()
+	callerSkipDefault = n
+	callerSkipMu.Unlock()
+}
+
+// SetPackageCallerSkip 为指定包路径单独设置跳过帧数，优先级高于 SetCallerSkip，
+// 适用于只有某个包下的 helper 需要额外跳帧、不希望影响其他调用方的场景
+func SetPackageCallerSkip(pkg string, n int) {
+	callerSkipMu.Lock()
+	if callerSkipByPackage == nil {
+		callerSkipByPackage = make(map[string]int)
+	}
+	callerSkipByPackage[pkg] = n
+	callerSkipMu.Unlock()
+}
+
+// logAt 是 Trace/Debug/Info/Warn/Error/Fatal/Panic 的共同实现，自行计算 caller 后
+// 通过 entry.Data 带给格式化器，从而不依赖 logrus 内置的、对包裹函数不友好的 caller 探测
+func logAt(level Level, args ...interface{}) {
+	if !myLog.IsLevelEnabled(level) {
+		return
+	}
+
+	entry := myLog.WithField(callerDataKey, frameWithSkip(callerBaseSkip))
+	entry.Log(level, args...)
+}
+
+// frameWithSkip 计算调用栈中 base 帧之外、经过全局或按包覆盖的额外跳帧后的 caller 信息
+func frameWithSkip(base int) *runtime.Frame {
+	frame, ok := callerAt(base)
+	if !ok {
+		return nil
+	}
+
+	callerSkipMu.RLock()
+	extra, overridden := callerSkipByPackage[packageName(frame.Function)]
+	if !overridden {
+		extra = callerSkipDefault
+	}
+	callerSkipMu.RUnlock()
+
+	if extra == 0 {
+		return frame
+	}
+
+	if outer, ok := callerAt(base + extra); ok {
+		return outer
+	}
+	return frame
+}
+
+func callerAt(skip int) (*runtime.Frame, bool) {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return nil, false
+	}
+
+	funcName := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		funcName = fn.Name()
+	}
+
+	return &runtime.Frame{File: file, Line: line, Function: funcName}, true
+}
+
+// packageName 从完整的函数名中提取包路径，逻辑与 logrus 内部的 getPackageName 一致：
+// 从右往左剥离一段 "."，直到剩余部分不再包含最后一个 "/" 之后的 "."
+func packageName(funcName string) string {
+	for {
+		lastPeriod := strings.LastIndex(funcName, ".")
+		lastSlash := strings.LastIndex(funcName, "/")
+		if lastPeriod > lastSlash {
+			funcName = funcName[:lastPeriod]
+		} else {
+			break
+		}
+	}
+	return funcName
+}
+
+// callerFrameForEntry 优先返回 logAt 手动计算出的 caller，没有的话回退到 logrus 自身
+// 的 ReportCaller 结果，兼容直接使用 WithFields(...).Info() 等原生调用方式
+func callerFrameForEntry(entry *Entry) (*runtime.Frame, bool) {
+	if v, ok := entry.Data[callerDataKey]; ok {
+		if frame, ok := v.(*runtime.Frame); ok && frame != nil {
+			return frame, true
+		}
+	}
+
+	if entry.HasCaller() {
+		return entry.Caller, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,120 @@
+package lancelog
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextExtractor 从 context.Context 中提取要附加到日志条目的字段
+type ContextExtractor func(context.Context) Fields
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = []ContextExtractor{otelContextExtractor}
+)
+
+// RegisterContextExtractor 注册一个额外的 ContextExtractor，WithContext 会依次
+// 调用所有已注册的 extractor 并合并它们返回的字段
+func RegisterContextExtractor(extractor ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, extractor)
+}
+
+// ContextValueExtractor 构造一个简单的 ContextExtractor，从 ctx 中按 key 取值，
+// 非空时以 fieldName 作为日志字段名
+func ContextValueExtractor(fieldName string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		v := ctx.Value(key)
+		if v == nil {
+			return nil
+		}
+		return Fields{fieldName: v}
+	}
+}
+
+// otelContextExtractor 是内置的 OpenTelemetry extractor，从当前 span 中提取
+// trace_id 和 span_id
+func otelContextExtractor(ctx context.Context) Fields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return Fields{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	}
+}
+
+// contextFields 合并所有已注册 extractor 从 ctx 中提取出的字段
+func contextFields(ctx context.Context) Fields {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	fields := Fields{}
+	for _, extractor := range extractors {
+		for k, v := range extractor(ctx) {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// WithContext 返回一个附带了从 ctx 中提取出的字段（如 trace_id/span_id）的日志 Entry
+func WithContext(ctx context.Context) *Entry {
+	return myLog.WithFields(contextFields(ctx))
+}
+
+// logCtxAt 是 TraceCtx/DebugCtx/.../PanicCtx 的共同实现，与 logAt 一样自行计算 caller，
+// 不能直接调用 WithContext(ctx).Info(...) 这类 logrus.Entry 方法——那样会让 lancelog 包
+// 自己的这层 *Ctx 函数被 logrus 内置的 caller 探测当成调用方，报出 lancelog_context.go
+// 自身的文件行号，而不是真正的调用处
+func logCtxAt(level Level, ctx context.Context, args ...interface{}) {
+	if !myLog.IsLevelEnabled(level) {
+		return
+	}
+
+	fields := contextFields(ctx)
+	fields[callerDataKey] = frameWithSkip(callerBaseSkip)
+
+	entry := myLog.WithFields(fields)
+	entry.Log(level, args...)
+}
+
+// TraceCtx 从 ctx 中提取字段后记录一条 Trace 级别日志
+func TraceCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(TraceLevel, ctx, args...)
+}
+
+// DebugCtx 从 ctx 中提取字段后记录一条 Debug 级别日志
+func DebugCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(DebugLevel, ctx, args...)
+}
+
+// InfoCtx 从 ctx 中提取字段后记录一条 Info 级别日志
+func InfoCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(InfoLevel, ctx, args...)
+}
+
+// WarnCtx 从 ctx 中提取字段后记录一条 Warn 级别日志
+func WarnCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(WarnLevel, ctx, args...)
+}
+
+// ErrorCtx 从 ctx 中提取字段后记录一条 Error 级别日志
+func ErrorCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(ErrorLevel, ctx, args...)
+}
+
+// FatalCtx 从 ctx 中提取字段后记录一条 Fatal 级别日志并终止进程，语义与顶层 Fatal 一致
+func FatalCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(FatalLevel, ctx, args...)
+	myLog.Exit(1)
+}
+
+// PanicCtx 从 ctx 中提取字段后记录一条 Panic 级别日志
+func PanicCtx(ctx context.Context, args ...interface{}) {
+	logCtxAt(PanicLevel, ctx, args...)
+}
@@ -0,0 +1,299 @@
+package lancelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dateLayout 是文件名中日期占位符使用的 Go 参考时间格式
+const dateLayout = "2006-01-02"
+
+// FileConfig 描述了滚动日志文件的配置
+type FileConfig struct {
+	// Filename 日志文件路径，支持在文件名中包含 "2006-01-02" 占位符以启用按天滚动，
+	// 例如 "app-2006-01-02.log"
+	Filename string
+
+	// MaxSize 单个日志文件的最大大小，单位 MB，<=0 表示不按大小滚动
+	MaxSize int
+
+	// MaxAge 日志文件的最大保留天数，<=0 表示不按时间清理
+	MaxAge int
+
+	// MaxBackups 保留的历史文件最大个数，<=0 表示不限制
+	MaxBackups int
+
+	// Compress 是否对滚动后的旧文件进行 gzip 压缩
+	Compress bool
+}
+
+// rotatingFile 实现了按大小/时间滚动并发安全写入的 io.WriteCloser
+type rotatingFile struct {
+	cfg FileConfig
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	day     string // 当前按天滚动所处的日期，仅在 filename 含日期占位符时使用
+	daily   bool
+	baseDir string
+	base    string // 历史文件的文件名前缀（见 backupPrefix），listBackups 用它匹配备份文件
+	ext     string
+}
+
+// SetFileOutput 将日志输出切换为按 cfg 配置滚动的文件
+func SetFileOutput(cfg FileConfig) error {
+	rf, err := newRotatingFile(cfg)
+	if err != nil {
+		return err
+	}
+	myLog.SetOutput(rf)
+	return nil
+}
+
+// MultiOutput 返回一个同时写入 os.Stdout 和按 cfg 配置滚动的文件的 io.Writer，
+// 可直接传给 SetOutput 使用
+func MultiOutput(cfg FileConfig) (io.Writer, error) {
+	rf, err := newRotatingFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiWriter(os.Stdout, rf), nil
+}
+
+func newRotatingFile(cfg FileConfig) (*rotatingFile, error) {
+	if cfg.Filename == "" {
+		return nil, fmt.Errorf("lancelog: FileConfig.Filename is required")
+	}
+
+	dir := filepath.Dir(cfg.Filename)
+	if dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("lancelog: create log dir: %w", err)
+		}
+	}
+
+	rf := &rotatingFile{
+		cfg:     cfg,
+		baseDir: dir,
+		daily:   strings.Contains(cfg.Filename, dateLayout),
+	}
+	rf.ext = filepath.Ext(cfg.Filename)
+	rf.base = backupPrefix(cfg.Filename, rf.ext, rf.daily)
+
+	if err := rf.openCurrent(); err != nil {
+		return nil, err
+	}
+
+	if rf.cfg.MaxAge > 0 {
+		rf.cleanupOldBackups()
+	}
+
+	return rf, nil
+}
+
+// backupPrefix 计算用于匹配历史文件的文件名前缀。按天滚动时 cfg.Filename 里的日期占位符
+// 还没有被替换成真实日期，直接取占位符之前的那一段，这样无论哪一天生成的备份文件都能匹配上；
+// 非按天滚动时就是去掉扩展名的文件名本身
+func backupPrefix(filename, ext string, daily bool) string {
+	base := filepath.Base(filename)
+	if daily {
+		if idx := strings.Index(base, dateLayout); idx >= 0 {
+			return base[:idx]
+		}
+	}
+	return strings.TrimSuffix(base, ext)
+}
+
+// currentFilename 根据是否按天滚动解析出当前应写入的文件路径
+func (rf *rotatingFile) currentFilename() string {
+	if rf.daily {
+		return strings.Replace(rf.cfg.Filename, dateLayout, time.Now().Format(dateLayout), 1)
+	}
+	return rf.cfg.Filename
+}
+
+func (rf *rotatingFile) openCurrent() error {
+	name := rf.currentFilename()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("lancelog: open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("lancelog: stat log file: %w", err)
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	rf.day = time.Now().Format(dateLayout)
+	return nil
+}
+
+// Write 实现 io.Writer，在必要时先完成滚动再写入，并发安全
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if err := rf.rotateIfNeeded(len(p)); err != nil {
+		return 0, err
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close 实现 io.Closer
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+func (rf *rotatingFile) rotateIfNeeded(nextWrite int) error {
+	dayChanged := rf.daily && time.Now().Format(dateLayout) != rf.day
+	sizeExceeded := rf.cfg.MaxSize > 0 && rf.size+int64(nextWrite) > int64(rf.cfg.MaxSize)*1024*1024
+
+	if !dayChanged && !sizeExceeded {
+		return nil
+	}
+
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("lancelog: close rotated log file: %w", err)
+	}
+
+	if sizeExceeded && !dayChanged {
+		if err := rf.rotateBySize(); err != nil {
+			return err
+		}
+	}
+
+	if err := rf.openCurrent(); err != nil {
+		return err
+	}
+
+	if rf.cfg.MaxAge > 0 {
+		rf.cleanupOldBackups()
+	}
+	rf.enforceBackupLimits()
+	return nil
+}
+
+// rotateBySize 把当前文件重命名为带时间戳的备份，并按需压缩
+func (rf *rotatingFile) rotateBySize() error {
+	cur := rf.currentFilename()
+	backupName := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(cur, rf.ext), time.Now().Format("20060102150405.000000"), rf.ext)
+
+	if err := os.Rename(cur, backupName); err != nil {
+		return fmt.Errorf("lancelog: rotate log file: %w", err)
+	}
+
+	if rf.cfg.Compress {
+		go compressFile(backupName)
+	}
+	return nil
+}
+
+func compressFile(name string) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer dst.Close()
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		return
+	}
+	if err := gz.Close(); err != nil {
+		return
+	}
+
+	os.Remove(name)
+}
+
+// enforceBackupLimits 清理超出 MaxBackups 的旧文件
+func (rf *rotatingFile) enforceBackupLimits() {
+	if rf.cfg.MaxBackups <= 0 {
+		return
+	}
+
+	backups := rf.listBackups()
+	if len(backups) <= rf.cfg.MaxBackups {
+		return
+	}
+
+	for _, b := range backups[:len(backups)-rf.cfg.MaxBackups] {
+		os.Remove(b)
+	}
+}
+
+// cleanupOldBackups 删除超过 MaxAge 天数的历史文件
+func (rf *rotatingFile) cleanupOldBackups() {
+	cutoff := time.Now().AddDate(0, 0, -rf.cfg.MaxAge)
+	for _, b := range rf.listBackups() {
+		info, err := os.Stat(b)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(b)
+		}
+	}
+}
+
+// listBackups 返回按修改时间升序排列的历史日志文件（不含当前正在写入的文件）
+func (rf *rotatingFile) listBackups() []string {
+	dir := rf.baseDir
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	current := rf.currentFilename()
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := filepath.Join(dir, e.Name())
+		if name == current {
+			continue
+		}
+		if !strings.HasPrefix(e.Name(), rf.base) {
+			continue
+		}
+		backups = append(backups, name)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		ii, _ := os.Stat(backups[i])
+		jj, _ := os.Stat(backups[j])
+		if ii == nil || jj == nil {
+			return false
+		}
+		return ii.ModTime().Before(jj.ModTime())
+	})
+
+	return backups
+}
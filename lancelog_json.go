@@ -0,0 +1,100 @@
+package lancelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Format 日志输出格式
+type Format int
+
+const (
+	// FormatNested 默认的精简嵌套格式，见 NestFormatter
+	FormatNested Format = iota
+	// FormatJSON 结构化 JSON 格式，便于接入 ELK/Loki 等日志系统
+	FormatJSON
+	// FormatText logrus 原生的文本格式
+	FormatText
+)
+
+// jsonReservedFields 是 JSONFormatter 固定输出的字段名，业务字段与其冲突时会被重命名
+var jsonReservedFields = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"msg":    true,
+	"caller": true,
+}
+
+// SetFormat 按枚举值切换日志输出格式，是 SetFormatter 的一个简化入口
+func SetFormat(format Format) {
+	switch format {
+	case FormatJSON:
+		myLog.SetFormatter(wrapFormatter(&JSONFormatter{}))
+	case FormatText:
+		myLog.SetFormatter(wrapFormatter(&logrus.TextFormatter{}))
+	default:
+		myLog.SetFormatter(defaultNestFormatter())
+	}
+}
+
+// JSONFormatter 以 JSON 形式输出日志条目，字段布局与 logrus 自带的 JSONFormatter 保持一致：
+// time 为 RFC3339Nano 时间戳，level 为小写字符串，caller 为 {file,line,function} 对象，
+// 业务字段平铺在顶层，与保留字段同名时会被重命名为 "fields.<key>"
+type JSONFormatter struct {
+	// PrettyPrint 是否对 JSON 输出做缩进美化，默认关闭
+	PrettyPrint bool
+}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Data[sampledDropKey] == true {
+		return nil, nil
+	}
+
+	data := make(map[string]interface{}, len(entry.Data)+4)
+	for k, v := range entry.Data {
+		if k == callerDataKey {
+			continue
+		}
+		key := k
+		if jsonReservedFields[k] {
+			key = "fields." + k
+		}
+		switch vv := v.(type) {
+		case error:
+			data[key] = vv.Error()
+		default:
+			data[key] = v
+		}
+	}
+
+	data["time"] = entry.Time.Format(time.RFC3339Nano)
+	data["level"] = entry.Level.String()
+	data["msg"] = entry.Message
+
+	if frame, ok := callerFrameForEntry(entry); ok {
+		data["caller"] = map[string]interface{}{
+			"file":     frame.File,
+			"line":     frame.Line,
+			"function": frame.Function,
+		}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("lancelog: marshal JSON log entry: %w", err)
+	}
+
+	if f.PrettyPrint {
+		var pretty []byte
+		pretty, err = json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("lancelog: marshal JSON log entry: %w", err)
+		}
+		b = pretty
+	}
+
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,244 @@
+package lancelog
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sampledDropKey 标记一条 entry 已被采样器丢弃，供 Formatter 在渲染阶段跳过输出
+const sampledDropKey = "__lancelog_sampled_drop__"
+
+// sampledReportInterval 是 sampled_dropped 计数的上报周期
+const sampledReportInterval = 30 * time.Second
+
+// Sampler 决定一条日志是否应当被放行，用于在高负载场景下抑制日志风暴
+type Sampler interface {
+	Allow(entry *Entry) bool
+}
+
+var (
+	activeSampler   atomic.Value // Sampler
+	samplingOnce    sync.Once
+	sampledDropped  uint64
+	samplingStarted int32
+)
+
+// SetSampler 启用采样：每条日志先经过 s.Allow 判定，不通过的会被丢弃。
+// 被丢弃的条数会作为 sampled_dropped 字段每 30s 上报一次，便于运维观察抑制情况
+func SetSampler(s Sampler) {
+	activeSampler.Store(s)
+
+	samplingOnce.Do(func() {
+		myLog.AddHook(&samplingHook{})
+		atomic.StoreInt32(&samplingStarted, 1)
+		go reportSampledDropped()
+	})
+}
+
+// samplingHook 是安装一次、通过 activeSampler 动态换挡的 logrus.Hook
+type samplingHook struct{}
+
+func (h *samplingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 只是把被丢弃的 entry 标记到 entry.Data 上，交由 Formatter 静默跳过输出；
+// 不能通过返回 error 的方式发信号——logrus 会把每个非 nil 的 hook error 打到 stderr，
+// 在本该压制日志风暴的场景下反而制造出同等频率的噪音
+func (h *samplingHook) Fire(entry *logrus.Entry) error {
+	sampler, _ := activeSampler.Load().(Sampler)
+	if sampler == nil || sampler.Allow(entry) {
+		return nil
+	}
+
+	atomic.AddUint64(&sampledDropped, 1)
+	entry.Data[sampledDropKey] = true
+	return nil
+}
+
+// selfAwareFormatter 由已经知道如何处理 sampledDropKey/callerDataKey 这两个内部字段的
+// Formatter（NestFormatter、JSONFormatter）实现，告诉 wrapFormatter 不需要再包一层
+type selfAwareFormatter interface {
+	handlesInternalFields()
+}
+
+func (f *NestFormatter) handlesInternalFields() {}
+func (f *JSONFormatter) handlesInternalFields() {}
+
+// sampledAwareFormatter 包装一个不认识 lancelog 内部字段的 Formatter（如
+// logrus.TextFormatter，或业务通过 SetFormatter 传入的任意实现），保证采样丢弃
+// 和 caller 隐藏字段对它们同样生效，而不是只对 NestFormatter/JSONFormatter 生效
+type sampledAwareFormatter struct {
+	inner logrus.Formatter
+}
+
+func (w *sampledAwareFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Data[sampledDropKey] == true {
+		return nil, nil
+	}
+
+	if _, ok := entry.Data[callerDataKey]; !ok {
+		return w.inner.Format(entry)
+	}
+
+	stripped := *entry
+	stripped.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if k == callerDataKey {
+			continue
+		}
+		stripped.Data[k] = v
+	}
+	return w.inner.Format(&stripped)
+}
+
+// wrapFormatter 让 SetFormatter/SetFormat 接受的任意 Formatter 都能正确处理
+// lancelog 的内部隐藏字段：已经自行处理过的直接透传，其余一律包一层
+// sampledAwareFormatter，使得被采样丢弃的 entry 在到达这些 Formatter 之前就被拦下，
+// 内部字段也不会被当成普通业务字段打印出去
+func wrapFormatter(inner logrus.Formatter) logrus.Formatter {
+	if _, ok := inner.(selfAwareFormatter); ok {
+		return inner
+	}
+	return &sampledAwareFormatter{inner: inner}
+}
+
+func reportSampledDropped() {
+	ticker := time.NewTicker(sampledReportInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if n := atomic.SwapUint64(&sampledDropped, 0); n > 0 {
+			myLog.WithField("sampled_dropped", n).Info("sampled log entries suppressed")
+		}
+		// 顺带清理当前生效的 tailSampler 里早已过期的计数器，否则不再出现的日志模板
+		// 会让 counters 这个 map 在长期运行的服务里只增不减
+		if ts, ok := activeSampler.Load().(*tailSampler); ok {
+			ts.prune(now)
+		}
+	}
+}
+
+// tokenBucketSampler 对每个日志级别独立维护一个令牌桶
+type tokenBucketSampler struct {
+	ratePerSec int
+	burst      int
+
+	mu      sync.Mutex
+	buckets map[Level]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketSampler 按 ratePerSec 的速率、burst 的突发容量限流，每个日志级别独立计数
+func NewTokenBucketSampler(ratePerSec, burst int) Sampler {
+	return &tokenBucketSampler{
+		ratePerSec: ratePerSec,
+		burst:      burst,
+		buckets:    make(map[Level]*tokenBucket),
+	}
+}
+
+func (s *tokenBucketSampler) Allow(entry *Entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[entry.Level]
+	if !ok {
+		b = &tokenBucket{tokens: float64(s.burst), last: now}
+		s.buckets[entry.Level] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * float64(s.ratePerSec)
+	if b.tokens > float64(s.burst) {
+		b.tokens = float64(s.burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// tailSampler 按 "日志模板 (消息+级别) 的哈希" 分桶：每个桶在窗口内的前 initial 条全部放行，
+// 之后每 thereafter 条放行 1 条，窗口过期后计数重置
+type tailSampler struct {
+	initial    int
+	thereafter int
+	window     time.Duration
+
+	mu       sync.Mutex
+	counters map[uint64]*tailCounter
+}
+
+type tailCounter struct {
+	count       int
+	windowStart time.Time
+}
+
+// NewTailSampler 构造一个"先全放行，再稀疏采样"的采样器：
+// 同一模板的日志，窗口内前 initial 条全部放行，此后每 thereafter 条放行 1 条。
+// thereafter <= 0 视为"此后全部丢弃"，而不是照字面意思去做除法——那样在 initial 条之后
+// 的第一条就会整除错误，把本该压制日志风暴的库变成风暴本身的进程杀手
+func NewTailSampler(initial, thereafter int, window time.Duration) Sampler {
+	return &tailSampler{
+		initial:    initial,
+		thereafter: thereafter,
+		window:     window,
+		counters:   make(map[uint64]*tailCounter),
+	}
+}
+
+func (s *tailSampler) Allow(entry *Entry) bool {
+	key := tailSampleKey(entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || now.Sub(c.windowStart) > s.window {
+		c = &tailCounter{windowStart: now}
+		s.counters[key] = c
+	}
+
+	c.count++
+	if c.count <= s.initial {
+		return true
+	}
+	if s.thereafter <= 0 {
+		return false
+	}
+	return (c.count-s.initial)%s.thereafter == 0
+}
+
+// prune 清掉早已过期窗口的计数器，避免不再出现的日志模板把 counters 撑成一个
+// 只增不减的 map
+func (s *tailSampler) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, c := range s.counters {
+		if now.Sub(c.windowStart) > s.window {
+			delete(s.counters, k)
+		}
+	}
+}
+
+func tailSampleKey(entry *Entry) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(entry.Level.String()))
+	h.Write([]byte{'|'})
+	h.Write([]byte(entry.Message))
+	return h.Sum64()
+}
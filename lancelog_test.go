@@ -1,8 +1,21 @@
 package lancelog
 
 import (
-	"github.com/sirupsen/logrus"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 func TestLog(t *testing.T) {
@@ -21,3 +34,607 @@ func TestLog(t *testing.T) {
 	WithFields(Fields{"hello": "world"}).Info("with fields test")
 
 }
+
+// TestFatalExitsProcess 通过重新执行测试二进制来验证 Fatal 会终止进程，
+// 而不是像 logrus.Entry.Log 那样只记录一条日志后继续运行
+func TestFatalExitsProcess(t *testing.T) {
+	if os.Getenv("LANCELOG_FATAL_SUBPROCESS") == "1" {
+		Fatal("fatal test")
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestFatalExitsProcess")
+	cmd.Env = append(os.Environ(), "LANCELOG_FATAL_SUBPROCESS=1")
+	err := cmd.Run()
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("expected Fatal to exit the process, got err=%v", err)
+	}
+	if exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitErr.ExitCode())
+	}
+}
+
+func wrappedInfo() {
+	Info("wrapped info")
+}
+
+// TestCallerSkip 验证 SetCallerSkip 能让被包装的 helper 报告出真实调用方的帧，
+// 而不是 helper 自身的定义位置
+func TestCallerSkip(t *testing.T) {
+	SetLevel(DebugLevel)
+
+	defer SetCallerSkip(0)
+
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+
+	wrappedInfo()
+
+	SetCallerSkip(1)
+	out.Reset()
+	wrappedInfo()
+
+	if !strings.Contains(out.String(), "[TestCallerSkip()]") {
+		t.Fatalf("expected SetCallerSkip(1) to report the caller of wrappedInfo, got: %s", out.String())
+	}
+}
+
+// TestTailSamplerDropsSilently 验证 NewTailSampler 只放行窗口内的前 initial 条、
+// 之后每 thereafter 条放行 1 条，被丢弃的条目不会出现在日志输出里
+func TestTailSamplerDropsSilently(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+
+	SetLevel(DebugLevel)
+	SetSampler(NewTailSampler(2, 3, time.Hour))
+	defer SetSampler(NewTailSampler(1, 1, 0))
+
+	for i := 0; i < 8; i++ {
+		Info("repeated message")
+	}
+
+	got := strings.Count(out.String(), "repeated message")
+	if got != 4 {
+		t.Fatalf("expected 4 allowed entries (1,2,5,8), got %d; output=%s", got, out.String())
+	}
+}
+
+// TestTailSamplerPrunesExpiredCounters 验证 prune 会清掉早已过期窗口的计数器，
+// 不再出现的日志模板不会让 counters 一直占着内存
+func TestTailSamplerPrunesExpiredCounters(t *testing.T) {
+	s := NewTailSampler(1, 1, time.Millisecond).(*tailSampler)
+
+	s.Allow(&Entry{Level: InfoLevel, Message: "prune test"})
+	if got := len(s.counters); got != 1 {
+		t.Fatalf("expected 1 counter after the first Allow, got %d", got)
+	}
+
+	s.prune(time.Now().Add(2 * time.Millisecond))
+	if got := len(s.counters); got != 0 {
+		t.Fatalf("expected prune to drop the expired counter, got %d remaining", got)
+	}
+}
+
+// TestTokenBucketSamplerAllowsBurstThenThrottles 验证 NewTokenBucketSampler
+// 在突发容量内放行、耗尽后拒绝，每个级别独立计数
+func TestTokenBucketSamplerAllowsBurstThenThrottles(t *testing.T) {
+	s := NewTokenBucketSampler(1, 2)
+	entry := &Entry{Level: InfoLevel}
+
+	if !s.Allow(entry) {
+		t.Fatalf("expected the 1st call within burst to be allowed")
+	}
+	if !s.Allow(entry) {
+		t.Fatalf("expected the 2nd call within burst to be allowed")
+	}
+	if s.Allow(entry) {
+		t.Fatalf("expected the 3rd call to exceed burst and be throttled")
+	}
+
+	other := &Entry{Level: WarnLevel}
+	if !s.Allow(other) {
+		t.Fatalf("expected a different level to have its own independent bucket")
+	}
+}
+
+// TestTailSamplerZeroThereafterDropsInsteadOfPanicking 验证 thereafter<=0 被当作
+// "初始配额用完后全部丢弃"处理，而不是照字面意思去做取模导致整除 0 panic
+func TestTailSamplerZeroThereafterDropsInsteadOfPanicking(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+
+	SetLevel(DebugLevel)
+	SetSampler(NewTailSampler(1, 0, time.Hour))
+	defer SetSampler(NewTailSampler(1, 1, 0))
+
+	for i := 0; i < 5; i++ {
+		Info("zero thereafter message")
+	}
+
+	got := strings.Count(out.String(), "zero thereafter message")
+	if got != 1 {
+		t.Fatalf("expected only the 1 entry within initial to be allowed, got %d; output=%s", got, out.String())
+	}
+}
+
+// TestSamplingDropsSilentlyRegardlessOfFormatter 验证采样丢弃对任意 Formatter 都生效，
+// 不依赖 Formatter 自己检查 sampledDropKey——logrus.TextFormatter 等内置/用户自定义的
+// Formatter 并不知道这个内部字段，之前的实现下采样在这种组合下形同虚设
+func TestSamplingDropsSilentlyRegardlessOfFormatter(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(FormatText)
+	defer func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatNested)
+	}()
+
+	SetLevel(DebugLevel)
+	SetSampler(NewTailSampler(1, 1000000, time.Hour))
+	defer SetSampler(NewTailSampler(1, 1, 0))
+
+	for i := 0; i < 5; i++ {
+		Info("flood message")
+	}
+
+	got := strings.Count(out.String(), "flood message")
+	if got != 1 {
+		t.Fatalf("expected logrus.TextFormatter to see only 1 allowed entry, got %d; output=%s", got, out.String())
+	}
+	if strings.Contains(out.String(), sampledDropKey) || strings.Contains(out.String(), callerDataKey) {
+		t.Fatalf("expected lancelog's internal fields not to leak into TextFormatter output: %s", out.String())
+	}
+}
+
+// TestSetFormatterWrapsUserFormatter 验证通过 SetFormatter 接入的自定义 Formatter
+// 同样不会看到被采样丢弃的 entry，也不会看到 callerDataKey 这个内部字段
+func TestSetFormatterWrapsUserFormatter(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormatter(&logrus.TextFormatter{})
+	defer func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatNested)
+	}()
+
+	SetLevel(DebugLevel)
+	SetSampler(NewTailSampler(1, 1000000, time.Hour))
+	defer SetSampler(NewTailSampler(1, 1, 0))
+
+	for i := 0; i < 3; i++ {
+		Info("custom formatter flood")
+	}
+
+	got := strings.Count(out.String(), "custom formatter flood")
+	if got != 1 {
+		t.Fatalf("expected a user-supplied Formatter set via SetFormatter to see only 1 allowed entry, got %d; output=%s", got, out.String())
+	}
+	if strings.Contains(out.String(), callerDataKey) {
+		t.Fatalf("expected callerDataKey not to leak into a user-supplied Formatter: %s", out.String())
+	}
+}
+
+// TestRotatingFileListBackupsMatchesDatedFiles 验证按天滚动时，已经写出过的带真实日期的
+// 历史文件能被 listBackups 识别到，而不是因为前缀取自未替换的 "2006-01-02" 占位符而漏判
+func TestRotatingFileListBackupsMatchesDatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := FileConfig{Filename: filepath.Join(dir, "app-2006-01-02.log")}
+
+	rf, err := newRotatingFile(cfg)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	dated := filepath.Join(dir, "app-"+time.Now().Format(dateLayout)+"-000000.000000.log")
+	if err := os.WriteFile(dated, []byte("old backup"), 0644); err != nil {
+		t.Fatalf("write fake backup: %v", err)
+	}
+
+	backups := rf.listBackups()
+	found := false
+	for _, b := range backups {
+		if b == dated {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected listBackups to include %s, got %v", dated, backups)
+	}
+}
+
+// TestRotationEnforcesMaxAgeOnEveryRotation 验证 MaxAge 清理不是只在 newRotatingFile 时
+// 生效一次，而是每次滚动都会重新执行——否则一个长期运行的进程只在启动那一刻清理过期备份，
+// 之后再老的备份也不会被删除
+func TestRotationEnforcesMaxAgeOnEveryRotation(t *testing.T) {
+	dir := t.TempDir()
+	cfg := FileConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 1, MaxAge: 1}
+
+	rf, err := newRotatingFile(cfg)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	stale := filepath.Join(dir, "app-20000101000000.000000.log")
+	if err := os.WriteFile(stale, []byte("ancient backup"), 0644); err != nil {
+		t.Fatalf("write stale backup: %v", err)
+	}
+	staleTime := time.Now().AddDate(0, 0, -30)
+	if err := os.Chtimes(stale, staleTime, staleTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	// 单次写入就超过 1MB 的 MaxSize，触发一次按大小滚动
+	big := make([]byte, 2*1024*1024)
+	if _, err := rf.Write(big); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale backup to be removed by MaxAge cleanup on rotation, stat err: %v", err)
+	}
+}
+
+// TestRotationCompressesBackupWhenConfigured 验证 Compress=true 时，滚动产生的备份文件
+// 最终会被 gzip 压缩成 .gz 并删除未压缩的原文件
+func TestRotationCompressesBackupWhenConfigured(t *testing.T) {
+	dir := t.TempDir()
+	cfg := FileConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 1, Compress: true}
+
+	rf, err := newRotatingFile(cfg)
+	if err != nil {
+		t.Fatalf("newRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	big := make([]byte, 2*1024*1024)
+	if _, err := rf.Write(big); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("ReadDir: %v", err)
+		}
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".log.gz") {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected a compressed .gz backup to appear in %s", dir)
+}
+
+// TestInfoCtxReportsRealCallSite 验证 InfoCtx 这类 *Ctx helper 报告的 caller 是真正
+// 调用它的这一行，而不是 lancelog_context.go 里 InfoCtx 自己的定义位置
+func TestInfoCtxReportsRealCallSite(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+
+	SetLevel(DebugLevel)
+	InfoCtx(context.Background(), "ctx info test")
+
+	if strings.Contains(out.String(), "lancelog_context.go") {
+		t.Fatalf("expected caller to point at the call site, not lancelog_context.go: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "lancelog_test.go") {
+		t.Fatalf("expected caller to point at lancelog_test.go, got: %s", out.String())
+	}
+}
+
+// TestEnableAsyncStopsPreviousWriter 验证重复调用 EnableAsync 不会让上一个实例的后台
+// goroutine 和 Fatal/Panic 钩子无限累积
+func TestEnableAsyncStopsPreviousWriter(t *testing.T) {
+	defer SetOutput(os.Stdout)
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		EnableAsync(8, Block)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := runtime.NumGoroutine(); got > before+1 {
+		t.Fatalf("expected old asyncWriter goroutines to be stopped, before=%d after=%d", before, got)
+	}
+
+	exitHooks := 0
+	for _, h := range myLog.Hooks[FatalLevel] {
+		if _, ok := h.(*asyncExitHook); ok {
+			exitHooks++
+		}
+	}
+	if exitHooks != 1 {
+		t.Fatalf("expected exactly one asyncExitHook installed, got %d", exitHooks)
+	}
+}
+
+// resetAsync 清空全局 currentAsync，避免前一个测试留下的 asyncWriter 干扰本次测试
+// 对 underlying writer 的注入（EnableAsync 在 currentAsync 非空时会继承它的 underlying，
+// 而不是当时的 myLog.Out）
+func resetAsync(t *testing.T) {
+	asyncMu.Lock()
+	prev := currentAsync
+	currentAsync = nil
+	asyncMu.Unlock()
+	if prev != nil {
+		prev.stop()
+	}
+	t.Cleanup(func() {
+		asyncMu.Lock()
+		aw := currentAsync
+		currentAsync = nil
+		asyncMu.Unlock()
+		if aw != nil {
+			aw.stop()
+		}
+		SetOutput(os.Stdout)
+	})
+}
+
+// blockingWriter 在 Write 返回前先阻塞在 release 上，并在第一次被调用时关闭 started，
+// 用来在测试里精确控制 run() 消费 channel 的节奏
+type blockingWriter struct {
+	started  chan struct{}
+	release  chan struct{}
+	startOne sync.Once
+
+	mu     sync.Mutex
+	writes [][]byte
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.startOne.Do(func() { close(w.started) })
+	<-w.release
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	w.mu.Lock()
+	w.writes = append(w.writes, buf)
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func (w *blockingWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.writes)
+}
+
+// TestFlushWaitsForUnderlyingWrite 验证 flush 等待的是底层 Write 真正返回，而不是
+// len(ch)==0——run 把最后一条从 ch 里取出和底层 Write 完成之间有一段时间差，
+// 只看队列长度的旧实现会在这段时间差内提前返回
+func TestFlushWaitsForUnderlyingWrite(t *testing.T) {
+	resetAsync(t)
+
+	var writeDone int32
+	bw := &slowWriter{delay: 80 * time.Millisecond, done: &writeDone}
+
+	SetOutput(bw)
+	EnableAsync(8, Block)
+
+	SetLevel(DebugLevel)
+	Info("flush test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if atomic.LoadInt32(&writeDone) != 1 {
+		t.Fatalf("expected the underlying Write to have completed before Flush returned")
+	}
+}
+
+// slowWriter 的底层 Write 人为延迟，用来制造"ch 已空但真正的写入还没完成"的窗口
+type slowWriter struct {
+	delay time.Duration
+	done  *int32
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	atomic.StoreInt32(w.done, 1)
+	return len(p), nil
+}
+
+// TestAsyncDropNewestDropsEntriesQueuedAfterBufferFull 验证 DropNewest 在队列打满后
+// 丢弃新到达的日志，保留队列里已有的
+func TestAsyncDropNewestDropsEntriesQueuedAfterBufferFull(t *testing.T) {
+	resetAsync(t)
+
+	bw := newBlockingWriter()
+	SetOutput(bw)
+	EnableAsync(1, DropNewest)
+
+	SetLevel(DebugLevel)
+	Info("m1")
+	<-bw.started // run() 已经取走 m1 并阻塞在它的 Write 里
+
+	Info("m2") // 填满容量为 1 的队列
+	Info("m3") // 队列已满，应被丢弃
+	Info("m4") // 同样应被丢弃
+
+	close(bw.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if got := bw.count(); got != 2 {
+		t.Fatalf("expected only m1 and m2 to be written, got %d writes", got)
+	}
+	if got := Stats().Dropped; got != 2 {
+		t.Fatalf("expected 2 dropped entries (m3, m4), got %d", got)
+	}
+}
+
+// TestAsyncDropOldestEvictsQueuedEntryForNewOne 验证 DropOldest 在队列打满后
+// 淘汰队列里最早的一条，为新日志腾出位置
+func TestAsyncDropOldestEvictsQueuedEntryForNewOne(t *testing.T) {
+	resetAsync(t)
+
+	bw := newBlockingWriter()
+	SetOutput(bw)
+	EnableAsync(1, DropOldest)
+
+	SetLevel(DebugLevel)
+	Info("m1")
+	<-bw.started // run() 已经取走 m1 并阻塞在它的 Write 里
+
+	Info("m2") // 填满容量为 1 的队列
+	Info("m3") // 淘汰 m2，m3 入队
+	Info("m4") // 淘汰 m3，m4 入队
+
+	close(bw.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if got := bw.count(); got != 2 {
+		t.Fatalf("expected only m1 and m4 to be written, got %d writes", got)
+	}
+	if got := Stats().Dropped; got != 2 {
+		t.Fatalf("expected 2 dropped entries (m2, m3), got %d", got)
+	}
+}
+
+// TestJSONFormatterUsesRFC3339Nano 验证 JSONFormatter 的 time 字段是标准的
+// time.RFC3339Nano，而不是总是零填充到 9 位小数的固定 layout
+func TestJSONFormatterUsesRFC3339Nano(t *testing.T) {
+	var out bytes.Buffer
+	SetOutput(&out)
+	SetFormat(FormatJSON)
+	defer func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatNested)
+	}()
+
+	SetLevel(DebugLevel)
+	Info("json timestamp test")
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("unmarshal JSON log line: %v; out=%s", err, out.String())
+	}
+
+	ts, ok := decoded["time"].(string)
+	if !ok {
+		t.Fatalf("expected time field to be a string, got %T", decoded["time"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		t.Fatalf("time field %q is not RFC3339Nano: %v", ts, err)
+	}
+}
+
+// TestRegisterContextExtractorMergesIntoWithContext 验证 RegisterContextExtractor
+// 注册的 extractor 会和内置的 otelContextExtractor 一起参与 WithContext 的字段合并
+func TestRegisterContextExtractorMergesIntoWithContext(t *testing.T) {
+	extractorsMu.Lock()
+	saved := extractors
+	extractorsMu.Unlock()
+	defer func() {
+		extractorsMu.Lock()
+		extractors = saved
+		extractorsMu.Unlock()
+	}()
+
+	type userIDKey struct{}
+	RegisterContextExtractor(ContextValueExtractor("user_id", userIDKey{}))
+
+	ctx := context.WithValue(context.Background(), userIDKey{}, "u-42")
+	entry := WithContext(ctx)
+
+	if got := entry.Data["user_id"]; got != "u-42" {
+		t.Fatalf("expected user_id field %q, got %v", "u-42", got)
+	}
+}
+
+// TestContextValueExtractorSkipsMissingKey 验证 ContextValueExtractor 在 ctx 中
+// 找不到对应 key 时不贡献任何字段，而不是写入一个 nil 值
+func TestContextValueExtractorSkipsMissingKey(t *testing.T) {
+	type missingKey struct{}
+	extractor := ContextValueExtractor("missing", missingKey{})
+
+	fields := extractor(context.Background())
+	if fields != nil {
+		t.Fatalf("expected no fields for a missing context value, got %v", fields)
+	}
+}
+
+// TestNestFormatterPackageFilterTrimsCallerFile 验证 PackageFilter 会从 caller 文件路径
+// 里剥离掉配置的前缀，便于在 module 路径很长的项目里保持日志简短
+func TestNestFormatterPackageFilterTrimsCallerFile(t *testing.T) {
+	frame, ok := callerAt(0)
+	if !ok {
+		t.Fatalf("callerAt(0) failed to report the current frame")
+	}
+	dir := filepath.Dir(frame.File) + string(filepath.Separator)
+
+	f := &NestFormatter{PackageFilter: dir}
+	entry := &Entry{
+		Level: InfoLevel,
+		Data:  Fields{callerDataKey: frame},
+	}
+
+	b, err := f.Format(entry)
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if strings.Contains(string(b), dir) {
+		t.Fatalf("expected PackageFilter prefix %q to be stripped, got %s", dir, b)
+	}
+}
+
+// TestSetPackageCallerSkipOverridesDefaultForPackage 验证 SetPackageCallerSkip 针对某个
+// 包设置的跳帧数优先于 SetCallerSkip 设置的全局默认值
+func TestSetPackageCallerSkipOverridesDefaultForPackage(t *testing.T) {
+	SetLevel(DebugLevel)
+	defer SetCallerSkip(0)
+
+	pkg := packageName(funcNameOf(wrappedInfo))
+
+	SetCallerSkip(1)
+	defer SetPackageCallerSkip(pkg, 0)
+	SetPackageCallerSkip(pkg, 0)
+
+	var out bytes.Buffer
+	SetOutput(&out)
+	defer SetOutput(os.Stdout)
+
+	wrappedInfo()
+
+	if !strings.Contains(out.String(), "[wrappedInfo()]") {
+		t.Fatalf("expected per-package skip override 0 to keep the caller at wrappedInfo, got: %s", out.String())
+	}
+}
+
+func funcNameOf(fn func()) string {
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}